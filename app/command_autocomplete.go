@@ -4,16 +4,33 @@
 package app
 
 import (
+	"context"
+	"math"
+	"net/http"
 	"net/url"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"github.com/pkg/errors"
 
 	"github.com/mattermost/mattermost-server/v5/mlog"
 	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/services/cache"
 )
 
-// GetSuggestions returns suggestions for user input.
-func (a *App) GetSuggestions(commands []*model.Command, userInput, roleID string) []model.AutocompleteSuggestion {
+// GetSuggestions returns suggestions for user input. userID, teamID and channelID identify who
+// is typing and where, so that entity arguments (see AutocompleteArgTypeEntity) can be scoped
+// and permission-checked against the right user and team/channel. ctx is checked between parse
+// steps so a caller (e.g. AutocompleteQuery) can abandon work superseded by a newer keystroke
+// before it issues further plugin GETs or entity lookups; it does not interrupt a fetch already
+// in flight.
+func (a *App) GetSuggestions(ctx context.Context, commands []*model.Command, userInput, roleID, userID, teamID, channelID string) []model.AutocompleteSuggestion {
 	sort.Slice(commands, func(i, j int) bool {
 		return strings.Compare(strings.ToLower(commands[i].Trigger), strings.ToLower(commands[j].Trigger)) < 0
 	})
@@ -26,7 +43,7 @@ func (a *App) GetSuggestions(commands []*model.Command, userInput, roleID string
 		autocompleteData = append(autocompleteData, command.AutocompleteData)
 	}
 
-	suggestions := a.getSuggestions(autocompleteData, "", userInput, roleID)
+	suggestions := a.getSuggestions(ctx, autocompleteData, "", userInput, roleID, userID, teamID, channelID)
 	for i, suggestion := range suggestions {
 		for _, command := range commands {
 			if strings.HasPrefix(suggestion.Complete, command.Trigger) {
@@ -38,21 +55,32 @@ func (a *App) GetSuggestions(commands []*model.Command, userInput, roleID string
 	return suggestions
 }
 
-func (a *App) getSuggestions(commands []*model.AutocompleteData, inputParsed, inputToBeParsed, roleID string) []model.AutocompleteSuggestion {
+func (a *App) getSuggestions(ctx context.Context, commands []*model.AutocompleteData, inputParsed, inputToBeParsed, roleID, userID, teamID, channelID string) []model.AutocompleteSuggestion {
+	if ctx.Err() != nil {
+		return []model.AutocompleteSuggestion{}
+	}
 	suggestions := []model.AutocompleteSuggestion{}
 	index := strings.Index(inputToBeParsed, " ")
 	if index == -1 { // no space in input
 		for _, command := range commands {
-			if strings.HasPrefix(command.Trigger, strings.ToLower(inputToBeParsed)) && (command.RoleID == roleID || roleID == model.SYSTEM_ADMIN_ROLE_ID || roleID == "") {
-				s := model.AutocompleteSuggestion{
-					Complete:    inputParsed + command.Trigger,
-					Suggestion:  command.Trigger,
-					Description: command.HelpText,
-					Hint:        command.Hint,
-				}
-				suggestions = append(suggestions, s)
+			if !(command.RoleID == roleID || roleID == model.SYSTEM_ADMIN_ROLE_ID || roleID == "") {
+				continue
+			}
+			matched, score, matchedIndexes := matchCandidate(command.MatchMode, inputToBeParsed, command.Trigger)
+			if !matched {
+				continue
 			}
+			s := model.AutocompleteSuggestion{
+				Complete:       inputParsed + command.Trigger,
+				Suggestion:     command.Trigger,
+				Description:    command.HelpText,
+				Hint:           command.Hint,
+				Score:          score,
+				MatchedIndexes: matchedIndexes,
+			}
+			suggestions = append(suggestions, s)
 		}
+		sortSuggestionsByScore(suggestions)
 		return suggestions
 	}
 	for _, command := range commands {
@@ -66,11 +94,11 @@ func (a *App) getSuggestions(commands []*model.AutocompleteData, inputParsed, in
 		parsed := inputParsed + inputToBeParsed[:index+1]
 		if len(command.Arguments) == 0 {
 			// Seek recursively in subcommands
-			subSuggestions := a.getSuggestions(command.SubCommands, parsed, toBeParsed, roleID)
+			subSuggestions := a.getSuggestions(ctx, command.SubCommands, parsed, toBeParsed, roleID, userID, teamID, channelID)
 			suggestions = append(suggestions, subSuggestions...)
 			continue
 		}
-		found, _, _, suggestion := a.parseArguments(command.Arguments, parsed, toBeParsed)
+		found, _, _, suggestion := a.parseArguments(ctx, command.Arguments, command.MatchMode, parsed, toBeParsed, userID, teamID, channelID)
 		if found {
 			suggestions = append(suggestions, suggestion...)
 		}
@@ -78,25 +106,111 @@ func (a *App) getSuggestions(commands []*model.AutocompleteData, inputParsed, in
 	return suggestions
 }
 
-func (a *App) parseArguments(args []*model.AutocompleteArg, parsed, toBeParsed string) (found bool, alreadyParsed string, yetToBeParsed string, suggestions []model.AutocompleteSuggestion) {
-	if len(args) == 0 {
+// matchCandidate reports whether input matches candidate under mode. It also returns a score
+// used to rank results and the candidate rune offsets that matched (for client-side
+// highlighting); both are only meaningful in AutocompleteMatchModeFuzzy, since prefix matches
+// are all equally good and always the candidate's leading runes.
+func matchCandidate(mode model.AutocompleteMatchMode, input, candidate string) (matched bool, score int, matchedIndexes []int) {
+	if mode != model.AutocompleteMatchModeFuzzy {
+		return strings.HasPrefix(strings.ToLower(candidate), strings.ToLower(input)), 0, nil
+	}
+	return fuzzyMatch(input, candidate)
+}
+
+func sortSuggestionsByScore(suggestions []model.AutocompleteSuggestion) {
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		return suggestions[i].Score > suggestions[j].Score
+	})
+}
+
+// fuzzyMinScore is the lowest score fuzzyMatch will accept; candidates that only barely contain
+// the input as a subsequence (long gaps, no word-boundary hits) score below it and are dropped.
+const fuzzyMinScore = -4
+
+// fuzzyMatch scores how well input matches candidate as an in-order subsequence, Smith-Waterman
+// style: consecutive runs and word-boundary hits (after '-', '_', space, or a camelCase hump) are
+// rewarded, gaps between matched runes are penalized. Every rune of input must appear in
+// candidate, in order, case-insensitively, or matched is false. The returned matchedIndexes are
+// candidate rune offsets, for clients to render the match highlighted.
+func fuzzyMatch(input, candidate string) (matched bool, score int, matchedIndexes []int) {
+	inputRunes := []rune(strings.ToLower(input))
+	if len(inputRunes) == 0 {
+		return true, 0, nil
+	}
+	candLower := []rune(strings.ToLower(candidate))
+	candOriginal := []rune(candidate)
+
+	const (
+		consecutiveBonus  = 8
+		wordBoundaryBonus = 6
+		gapPenaltyPerRune = 1
+	)
+
+	matchedIndexes = make([]int, 0, len(inputRunes))
+	candIdx := 0
+	prevMatch := -2
+	for _, r := range inputRunes {
+		found := -1
+		for ; candIdx < len(candLower); candIdx++ {
+			if candLower[candIdx] == r {
+				found = candIdx
+				break
+			}
+		}
+		if found == -1 {
+			return false, 0, nil
+		}
+		if found == prevMatch+1 {
+			score += consecutiveBonus
+		} else if prevMatch >= 0 {
+			score -= (found - prevMatch - 1) * gapPenaltyPerRune
+		}
+		if isFuzzyWordBoundary(candOriginal, found) {
+			score += wordBoundaryBonus
+		}
+		matchedIndexes = append(matchedIndexes, found)
+		prevMatch = found
+		candIdx++
+	}
+	if score < fuzzyMinScore {
+		return false, 0, nil
+	}
+	return true, score, matchedIndexes
+}
+
+// isFuzzyWordBoundary reports whether candidate[i] starts a new "word" within candidate: the
+// very first rune, the rune right after a '-', '_' or space, or the upper-case half of a
+// camelCase hump.
+func isFuzzyWordBoundary(candidate []rune, i int) bool {
+	if i == 0 {
+		return true
+	}
+	switch candidate[i-1] {
+	case '-', '_', ' ':
+		return true
+	}
+	return unicode.IsUpper(candidate[i]) && unicode.IsLower(candidate[i-1])
+}
+
+func (a *App) parseArguments(ctx context.Context, args []*model.AutocompleteArg, mode model.AutocompleteMatchMode, parsed, toBeParsed, userID, teamID, channelID string) (found bool, alreadyParsed string, yetToBeParsed string, suggestions []model.AutocompleteSuggestion) {
+	if len(args) == 0 || ctx.Err() != nil {
 		return false, parsed, toBeParsed, suggestions
 	}
 	if args[0].Required {
-		found, changedParsed, changedToBeParsed, suggestion := a.parseArgument(args[0], parsed, toBeParsed)
+		found, changedParsed, changedToBeParsed, suggestion := a.parseArgument(ctx, args[0], mode, parsed, toBeParsed, userID, teamID, channelID)
 		if found {
 			suggestions = append(suggestions, suggestion...)
 			return true, changedParsed, changedToBeParsed, suggestions
 		}
-		return a.parseArguments(args[1:], changedParsed, changedToBeParsed)
+		return a.parseArguments(ctx, args[1:], mode, changedParsed, changedToBeParsed, userID, teamID, channelID)
 	}
 	// Handling optional arguments. Optional argument can be inputted or not,
 	// so we have to pase both cases recursively and output combined suggestions.
-	foundWithOptional, changedParsedWithOptional, changedToBeParsedWithOptional, suggestionsWithOptional := a.parseArgument(args[0], parsed, toBeParsed)
+	foundWithOptional, changedParsedWithOptional, changedToBeParsedWithOptional, suggestionsWithOptional := a.parseArgument(ctx, args[0], mode, parsed, toBeParsed, userID, teamID, channelID)
 	if foundWithOptional {
 		suggestions = append(suggestions, suggestionsWithOptional...)
 	} else {
-		foundWithOptionalRest, changedParsedWithOptionalRest, changedToBeParsedWithOptionalRest, suggestionsWithOptionalRest := a.parseArguments(args[1:], changedParsedWithOptional, changedToBeParsedWithOptional)
+		foundWithOptionalRest, changedParsedWithOptionalRest, changedToBeParsedWithOptionalRest, suggestionsWithOptionalRest := a.parseArguments(ctx, args[1:], mode, changedParsedWithOptional, changedToBeParsedWithOptional, userID, teamID, channelID)
 		if foundWithOptionalRest {
 			suggestions = append(suggestions, suggestionsWithOptionalRest...)
 		}
@@ -105,7 +219,7 @@ func (a *App) parseArguments(args []*model.AutocompleteArg, parsed, toBeParsed s
 		changedToBeParsedWithOptional = changedToBeParsedWithOptionalRest
 	}
 
-	foundWithoutOptional, changedParsedWithoutOptional, changedToBeParsedWithoutOptional, suggestionsWithoutOptional := a.parseArguments(args[1:], parsed, toBeParsed)
+	foundWithoutOptional, changedParsedWithoutOptional, changedToBeParsedWithoutOptional, suggestionsWithoutOptional := a.parseArguments(ctx, args[1:], mode, parsed, toBeParsed, userID, teamID, channelID)
 	if foundWithoutOptional {
 		suggestions = append(suggestions, suggestionsWithoutOptional...)
 	}
@@ -122,7 +236,7 @@ func (a *App) parseArguments(args []*model.AutocompleteArg, parsed, toBeParsed s
 	return foundWithoutOptional, changedParsedWithoutOptional, changedToBeParsedWithoutOptional, suggestions
 }
 
-func (a *App) parseArgument(arg *model.AutocompleteArg, parsed, toBeParsed string) (found bool, alreadyParsed string, yetToBeParsed string, suggestions []model.AutocompleteSuggestion) {
+func (a *App) parseArgument(ctx context.Context, arg *model.AutocompleteArg, mode model.AutocompleteMatchMode, parsed, toBeParsed, userID, teamID, channelID string) (found bool, alreadyParsed string, yetToBeParsed string, suggestions []model.AutocompleteSuggestion) {
 	if arg.Name != "" { //Parse the --name first
 		found, changedParsed, changedToBeParsed, suggestion := parseNamedArgument(arg, parsed, toBeParsed)
 		if found {
@@ -147,7 +261,7 @@ func (a *App) parseArgument(arg *model.AutocompleteArg, parsed, toBeParsed strin
 		parsed = changedParsed
 		toBeParsed = changedToBeParsed
 	} else if arg.Type == model.AutocompleteArgTypeStaticList {
-		found, changedParsed, changedToBeParsed, staticListsuggestions := parseStaticListArgument(arg, parsed, toBeParsed)
+		found, changedParsed, changedToBeParsed, staticListsuggestions := parseStaticListArgument(arg, mode, parsed, toBeParsed)
 		if found {
 			suggestions = append(suggestions, staticListsuggestions...)
 			return true, changedParsed, changedToBeParsed, suggestions
@@ -155,13 +269,53 @@ func (a *App) parseArgument(arg *model.AutocompleteArg, parsed, toBeParsed strin
 		parsed = changedParsed
 		toBeParsed = changedToBeParsed
 	} else if arg.Type == model.AutocompleteArgTypeDynamicList {
-		found, changedParsed, changedToBeParsed, dynamicListsuggestions := a.parseDynamicListArgument(arg, parsed, toBeParsed)
+		found, changedParsed, changedToBeParsed, dynamicListsuggestions := a.parseDynamicListArgument(ctx, arg, mode, parsed, toBeParsed, userID)
 		if found {
 			suggestions = append(suggestions, dynamicListsuggestions...)
 			return true, changedParsed, changedToBeParsed, suggestions
 		}
 		parsed = changedParsed
 		toBeParsed = changedToBeParsed
+	} else if arg.Type == model.AutocompleteArgTypeEntity {
+		found, changedParsed, changedToBeParsed, entitysuggestions := a.parseEntityListArgument(ctx, arg, mode, parsed, toBeParsed, userID, teamID, channelID)
+		if found {
+			suggestions = append(suggestions, entitysuggestions...)
+			return true, changedParsed, changedToBeParsed, suggestions
+		}
+		parsed = changedParsed
+		toBeParsed = changedToBeParsed
+	} else if arg.Type == model.AutocompleteArgTypeNumber {
+		found, changedParsed, changedToBeParsed, suggestion := parseInputNumberArgument(arg, parsed, toBeParsed)
+		if found {
+			suggestions = append(suggestions, suggestion)
+			return true, changedParsed, changedToBeParsed, suggestions
+		}
+		parsed = changedParsed
+		toBeParsed = changedToBeParsed
+	} else if arg.Type == model.AutocompleteArgTypeBool {
+		found, changedParsed, changedToBeParsed, suggestion := parseInputBoolArgument(arg, parsed, toBeParsed)
+		if found {
+			suggestions = append(suggestions, suggestion)
+			return true, changedParsed, changedToBeParsed, suggestions
+		}
+		parsed = changedParsed
+		toBeParsed = changedToBeParsed
+	} else if arg.Type == model.AutocompleteArgTypeDate {
+		found, changedParsed, changedToBeParsed, suggestion := parseInputDateArgument(arg, parsed, toBeParsed)
+		if found {
+			suggestions = append(suggestions, suggestion)
+			return true, changedParsed, changedToBeParsed, suggestions
+		}
+		parsed = changedParsed
+		toBeParsed = changedToBeParsed
+	} else if arg.Type == model.AutocompleteArgTypeRegex {
+		found, changedParsed, changedToBeParsed, suggestion := parseInputRegexArgument(arg, parsed, toBeParsed)
+		if found {
+			suggestions = append(suggestions, suggestion)
+			return true, changedParsed, changedToBeParsed, suggestions
+		}
+		parsed = changedParsed
+		toBeParsed = changedToBeParsed
 	}
 	return false, parsed, toBeParsed, suggestions
 }
@@ -170,10 +324,10 @@ func parseNamedArgument(arg *model.AutocompleteArg, parsed, toBeParsed string) (
 	in := strings.TrimPrefix(toBeParsed, " ")
 	namedArg := "--" + arg.Name
 	if in == "" { //The user has not started typing the argument.
-		return true, parsed + toBeParsed, "", model.AutocompleteSuggestion{Complete: parsed + toBeParsed + namedArg + " ", Suggestion: namedArg, Hint: "", Description: arg.HelpText}
+		return true, parsed + toBeParsed, "", model.AutocompleteSuggestion{Complete: parsed + toBeParsed + namedArg + " ", Suggestion: namedArg, Hint: arg.Hint, Description: arg.HelpText}
 	}
 	if strings.HasPrefix(strings.ToLower(namedArg), strings.ToLower(in)) {
-		return true, parsed + toBeParsed, "", model.AutocompleteSuggestion{Complete: parsed + toBeParsed + namedArg[len(in):] + " ", Suggestion: namedArg, Hint: "", Description: arg.HelpText}
+		return true, parsed + toBeParsed, "", model.AutocompleteSuggestion{Complete: parsed + toBeParsed + namedArg[len(in):] + " ", Suggestion: namedArg, Hint: arg.Hint, Description: arg.HelpText}
 	}
 
 	if !strings.HasPrefix(strings.ToLower(in), strings.ToLower(namedArg)+" ") {
@@ -212,34 +366,465 @@ func parseInputTextArgument(arg *model.AutocompleteArg, parsed, toBeParsed strin
 	return false, parsed + in[:index+1], in[index+1:], model.AutocompleteSuggestion{}
 }
 
-func parseStaticListArgument(arg *model.AutocompleteArg, parsed, toBeParsed string) (found bool, alreadyParsed string, yetToBeParsed string, suggestions []model.AutocompleteSuggestion) {
+// singleWordValue splits toBeParsed (after trimming its leading space) into the single word the
+// user is currently typing and whether they have finished typing it (reached a trailing space).
+func singleWordValue(toBeParsed string) (value string, finished bool) {
+	in := strings.TrimPrefix(toBeParsed, " ")
+	if index := strings.Index(in, " "); index != -1 {
+		return in[:index], true
+	}
+	return in, false
+}
+
+// advancePastSingleWord returns the (parsed, toBeParsed) pair for once a single-word argument
+// has been fully typed and validated, i.e. consuming it and the space that terminated it.
+func advancePastSingleWord(parsed, toBeParsed string) (string, string) {
+	in := strings.TrimPrefix(toBeParsed, " ")
+	index := strings.Index(in, " ")
+	return parsed + in[:index+1], in[index+1:]
+}
+
+func parseInputNumberArgument(arg *model.AutocompleteArg, parsed, toBeParsed string) (found bool, alreadyParsed string, yetToBeParsed string, suggestion model.AutocompleteSuggestion) {
+	data := arg.Data.(*model.AutocompleteNumberArg)
+	value, finished := singleWordValue(toBeParsed)
+	if value == "" || !finished {
+		return true, parsed + toBeParsed, "", model.AutocompleteSuggestion{Complete: parsed + toBeParsed, Hint: arg.Hint, Description: arg.HelpText}
+	}
+
+	num, parseErr := strconv.ParseFloat(value, 64)
+	if parseErr != nil {
+		return true, parsed + toBeParsed, "", model.AutocompleteSuggestion{Complete: parsed + toBeParsed, Description: arg.HelpText, ErrorHint: "expected a number"}
+	}
+	if errorHint := data.Validate(num); errorHint != "" {
+		return true, parsed + toBeParsed, "", model.AutocompleteSuggestion{Complete: parsed + toBeParsed, Description: arg.HelpText, ErrorHint: errorHint}
+	}
+	newParsed, newToBeParsed := advancePastSingleWord(parsed, toBeParsed)
+	return false, newParsed, newToBeParsed, model.AutocompleteSuggestion{}
+}
+
+func parseInputBoolArgument(arg *model.AutocompleteArg, parsed, toBeParsed string) (found bool, alreadyParsed string, yetToBeParsed string, suggestion model.AutocompleteSuggestion) {
+	value, finished := singleWordValue(toBeParsed)
+	if value == "" || !finished {
+		return true, parsed + toBeParsed, "", model.AutocompleteSuggestion{Complete: parsed + toBeParsed, Hint: arg.Hint, Description: arg.HelpText}
+	}
+
+	lower := strings.ToLower(value)
+	if lower != "true" && lower != "false" {
+		return true, parsed + toBeParsed, "", model.AutocompleteSuggestion{Complete: parsed + toBeParsed, Description: arg.HelpText, ErrorHint: "expected true or false"}
+	}
+	newParsed, newToBeParsed := advancePastSingleWord(parsed, toBeParsed)
+	return false, newParsed, newToBeParsed, model.AutocompleteSuggestion{}
+}
+
+func parseInputDateArgument(arg *model.AutocompleteArg, parsed, toBeParsed string) (found bool, alreadyParsed string, yetToBeParsed string, suggestion model.AutocompleteSuggestion) {
+	data := arg.Data.(*model.AutocompleteDateArg)
+	value, finished := singleWordValue(toBeParsed)
+	if value == "" || !finished {
+		return true, parsed + toBeParsed, "", model.AutocompleteSuggestion{Complete: parsed + toBeParsed, Hint: arg.Hint, Description: arg.HelpText}
+	}
+
+	if _, parseErr := time.Parse(data.GoLayout(), value); parseErr != nil {
+		return true, parsed + toBeParsed, "", model.AutocompleteSuggestion{Complete: parsed + toBeParsed, Description: arg.HelpText, ErrorHint: "expected format " + data.DisplayFormat()}
+	}
+	newParsed, newToBeParsed := advancePastSingleWord(parsed, toBeParsed)
+	return false, newParsed, newToBeParsed, model.AutocompleteSuggestion{}
+}
+
+func parseInputRegexArgument(arg *model.AutocompleteArg, parsed, toBeParsed string) (found bool, alreadyParsed string, yetToBeParsed string, suggestion model.AutocompleteSuggestion) {
+	data := arg.Data.(*model.AutocompleteRegexArg)
+	value, finished := singleWordValue(toBeParsed)
+	if value == "" || !finished {
+		return true, parsed + toBeParsed, "", model.AutocompleteSuggestion{Complete: parsed + toBeParsed, Hint: arg.Hint, Description: arg.HelpText}
+	}
+
+	matched, matchErr := regexp.MatchString("^"+data.Pattern+"$", value)
+	if matchErr != nil || !matched {
+		return true, parsed + toBeParsed, "", model.AutocompleteSuggestion{Complete: parsed + toBeParsed, Description: arg.HelpText, ErrorHint: "must match pattern " + data.Pattern}
+	}
+	newParsed, newToBeParsed := advancePastSingleWord(parsed, toBeParsed)
+	return false, newParsed, newToBeParsed, model.AutocompleteSuggestion{}
+}
+
+func parseStaticListArgument(arg *model.AutocompleteArg, mode model.AutocompleteMatchMode, parsed, toBeParsed string) (found bool, alreadyParsed string, yetToBeParsed string, suggestions []model.AutocompleteSuggestion) {
 	a := arg.Data.(*model.AutocompleteStaticListArg)
-	return parseListItems(a.PossibleArguments, parsed, toBeParsed)
+	return parseListItems(a.PossibleArguments, mode, parsed, toBeParsed)
 }
 
-// GetDynamicListArgument returns autocomplete list items for the command's dynamic argument.
-func (a *App) GetDynamicListArgument(fetchURL, parsed, toBeParsed string) ([]model.AutocompleteListItem, error) {
+// dynamicListCache holds cached App.GetDynamicListArgument responses, keyed by fetch URL,
+// already-parsed prefix and requesting user, so that consecutive keystrokes against the same
+// plugin endpoint don't each force a new HTTP GET. See dynamicListCacheKey.
+var dynamicListCache = cache.NewLRU(cache.LRUOptions{Size: 10000})
+
+var dynamicListCacheHits, dynamicListCacheMisses int64
+
+// dynamicListCacheStatsByURL breaks the aggregate hit/miss counters down per FetchURL (one entry
+// per distinct plugin endpoint, not per command — several commands can share a FetchURL), so a
+// single noisy or misconfigured integration's hit rate doesn't get averaged away by the rest.
+var dynamicListCacheStatsByURL sync.Map // fetchURL -> *dynamicListCacheStats
+
+type dynamicListCacheStats struct {
+	hits   int64
+	misses int64
+}
+
+func recordDynamicListCacheResult(fetchURL string, hit bool) {
+	statsIface, _ := dynamicListCacheStatsByURL.LoadOrStore(fetchURL, &dynamicListCacheStats{})
+	stats := statsIface.(*dynamicListCacheStats)
+	if hit {
+		atomic.AddInt64(&dynamicListCacheHits, 1)
+		atomic.AddInt64(&stats.hits, 1)
+	} else {
+		atomic.AddInt64(&dynamicListCacheMisses, 1)
+		atomic.AddInt64(&stats.misses, 1)
+	}
+}
+
+type dynamicListCacheEntry struct {
+	term      string // the user_input this entry was fetched for
+	items     []model.AutocompleteListItem
+	etag      string
+	expiresAt int64 // model.GetMillis() value the entry is valid until; 0 means no TTL was given
+}
+
+func dynamicListCacheKey(fetchURL, parsed, userID string) string {
+	return fetchURL + "|" + parsed + "|" + userID
+}
+
+// DynamicListArgumentCacheHitRate returns the fraction of GetDynamicListArgument calls, across
+// all commands, that were served from the cache rather than a plugin HTTP GET.
+//
+// This is a bare in-process accessor over package-global counters, not a registered metric: this
+// package has no metrics service to register against (see services/metrics elsewhere in the
+// server), so there is nothing here to wire into. DynamicListArgumentCacheHitRateForURL gives the
+// per-endpoint breakdown; a metrics service, when one is added to this package, should read both
+// rather than duplicate the counters.
+func (a *App) DynamicListArgumentCacheHitRate() float64 {
+	hits := atomic.LoadInt64(&dynamicListCacheHits)
+	misses := atomic.LoadInt64(&dynamicListCacheMisses)
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses)
+}
+
+// DynamicListArgumentCacheHitRateForURL returns the cache hit rate for GetDynamicListArgument
+// calls against a single plugin FetchURL, or 0 if it has never been queried.
+func (a *App) DynamicListArgumentCacheHitRateForURL(fetchURL string) float64 {
+	statsIface, ok := dynamicListCacheStatsByURL.Load(fetchURL)
+	if !ok {
+		return 0
+	}
+	stats := statsIface.(*dynamicListCacheStats)
+	hits := atomic.LoadInt64(&stats.hits)
+	misses := atomic.LoadInt64(&stats.misses)
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses)
+}
+
+// GetDynamicListArgument returns autocomplete list items for the command's dynamic argument,
+// serving from dynamicListCache when cachePolicy allows it. ctx is checked before the plugin GET
+// is dispatched, so a query superseded by a newer keystroke (see AutocompleteQuery) never starts
+// a fetch for input the client has already moved past; it cannot abort a fetch already in flight.
+func (a *App) GetDynamicListArgument(ctx context.Context, fetchURL string, cachePolicy model.AutocompleteCachePolicy, userID, parsed, toBeParsed string) ([]model.AutocompleteListItem, error) {
+	if cachePolicy == "" {
+		cachePolicy = model.AutocompleteCachePolicyNone
+	}
+	term := parsed + toBeParsed
+	cacheKey := dynamicListCacheKey(fetchURL, parsed, userID)
+
+	if cachePolicy != model.AutocompleteCachePolicyNone {
+		if items, ok := lookupDynamicListCache(cacheKey, term, cachePolicy); ok {
+			recordDynamicListCacheResult(fetchURL, true)
+			return items, nil
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	recordDynamicListCacheResult(fetchURL, false)
+
 	params := url.Values{}
-	params.Add("user_input", parsed+toBeParsed)
+	params.Add("user_input", term)
 	params.Add("parsed", parsed)
+	if cachePolicy != model.AutocompleteCachePolicyNone {
+		// Only revalidate against a cached etag fetched for this exact term: a plugin may key its
+		// etag on data version rather than user_input, and a 304 for a different term would
+		// resurrect that term's stale items as the answer to this one.
+		if cached, ok := dynamicListCache.Get(cacheKey); ok {
+			if entry, ok := cached.(*dynamicListCacheEntry); ok && entry.etag != "" && entry.term == term {
+				params.Add("if_none_match", entry.etag)
+			}
+		}
+	}
+
 	resp, err := a.doPluginRequest("GET", fetchURL, params, nil)
 	if err != nil {
 		a.Log().Error("Can't fetch dynamic list arguments for", mlog.String("url", fetchURL), mlog.Err(err))
 		return nil, err
 	}
-	return model.AutocompleteStaticListItemsFromJSON(resp.Body), nil
+
+	if resp.StatusCode == http.StatusNotModified {
+		if cached, ok := dynamicListCache.Get(cacheKey); ok {
+			if entry, ok := cached.(*dynamicListCacheEntry); ok {
+				// Concurrent AutocompleteQuery calls on the same session can race this Get/Set
+				// against another goroutine's read of the same cached entry (see
+				// lookupDynamicListCache), so the entry must never be mutated in place: build a
+				// fresh one with the renewed expiry instead.
+				refreshed := &dynamicListCacheEntry{
+					term:      entry.term,
+					items:     entry.items,
+					etag:      entry.etag,
+					expiresAt: dynamicListCacheExpiresAt(resp.Header.Get("Cache-Control")),
+				}
+				dynamicListCache.Set(cacheKey, refreshed)
+				return refreshed.items, nil
+			}
+		}
+	}
+
+	items := model.AutocompleteStaticListItemsFromJSON(resp.Body)
+	if cachePolicy != model.AutocompleteCachePolicyNone {
+		dynamicListCache.Set(cacheKey, &dynamicListCacheEntry{
+			term:      term,
+			items:     items,
+			etag:      resp.Header.Get("ETag"),
+			expiresAt: dynamicListCacheExpiresAt(resp.Header.Get("Cache-Control")),
+		})
+	}
+	return items, nil
+}
+
+// lookupDynamicListCache looks for a still-valid cached response for term. Under
+// AutocompleteCachePolicyPrefix, a cached response fetched for a prefix of term is also
+// accepted, and its items are filtered down to those still matching the current word in memory,
+// sparing a round trip for every keystroke after the first in a run.
+func lookupDynamicListCache(cacheKey, term string, policy model.AutocompleteCachePolicy) ([]model.AutocompleteListItem, bool) {
+	cached, ok := dynamicListCache.Get(cacheKey)
+	if !ok {
+		return nil, false
+	}
+	entry, ok := cached.(*dynamicListCacheEntry)
+	if !ok {
+		return nil, false
+	}
+	if entry.expiresAt != 0 && entry.expiresAt <= model.GetMillis() {
+		return nil, false
+	}
+	if entry.term == term {
+		return entry.items, true
+	}
+	if policy == model.AutocompleteCachePolicyPrefix && strings.HasPrefix(strings.ToLower(term), strings.ToLower(entry.term)) {
+		// entry.items holds bare values (e.g. "carol"), not full command lines, so they must be
+		// filtered against the word currently being typed, not the full parsed+toBeParsed term.
+		word := currentWord(term)
+		filtered := make([]model.AutocompleteListItem, 0, len(entry.items))
+		for _, item := range entry.items {
+			if strings.HasPrefix(strings.ToLower(item.Item), strings.ToLower(word)) {
+				filtered = append(filtered, item)
+			}
+		}
+		return filtered, true
+	}
+	return nil, false
+}
+
+// currentWord returns the last whitespace-delimited token of term, the word the user is
+// currently typing.
+func currentWord(term string) string {
+	if index := strings.LastIndex(term, " "); index != -1 {
+		return term[index+1:]
+	}
+	return term
 }
 
-func (a *App) parseDynamicListArgument(arg *model.AutocompleteArg, parsed, toBeParsed string) (found bool, alreadyParsed string, yetToBeParsed string, suggestions []model.AutocompleteSuggestion) {
+// dynamicListCacheExpiresAt turns a Cache-Control header's max-age directive into an absolute
+// model.GetMillis() expiry. It returns 0 (no TTL) if the header is absent or unparseable.
+func dynamicListCacheExpiresAt(cacheControl string) int64 {
+	if cacheControl == "" {
+		return 0
+	}
+	for _, directive := range strings.Split(cacheControl, ",") {
+		directive = strings.TrimSpace(directive)
+		if !strings.HasPrefix(directive, "max-age=") {
+			continue
+		}
+		maxAgeSeconds, err := strconv.ParseInt(strings.TrimPrefix(directive, "max-age="), 10, 64)
+		if err != nil || maxAgeSeconds < 0 {
+			return 0
+		}
+		return model.GetMillis() + maxAgeSeconds*1000
+	}
+	return 0
+}
+
+func (a *App) parseDynamicListArgument(ctx context.Context, arg *model.AutocompleteArg, mode model.AutocompleteMatchMode, parsed, toBeParsed, userID string) (found bool, alreadyParsed string, yetToBeParsed string, suggestions []model.AutocompleteSuggestion) {
 	dynamicArg := arg.Data.(*model.AutocompleteDynamicListArg)
-	listItems, err := a.GetDynamicListArgument(dynamicArg.FetchURL, parsed, toBeParsed)
+	listItems, err := a.GetDynamicListArgument(ctx, dynamicArg.FetchURL, dynamicArg.CachePolicy, userID, parsed, toBeParsed)
 	if err != nil {
 		return false, parsed, toBeParsed, []model.AutocompleteSuggestion{}
 	}
-	return parseListItems(listItems, parsed, toBeParsed)
+	return parseListItems(listItems, mode, parsed, toBeParsed)
+}
+
+// parseEntityListArgument suggests built-in Mattermost entities (users, channels, teams, posts)
+// for an AutocompleteArgTypeEntity argument. Unlike parseDynamicListArgument, it never leaves
+// the server: it calls straight into the existing search services, scoped and permission-checked
+// against userID, rather than issuing an HTTP GET to a plugin.
+func (a *App) parseEntityListArgument(ctx context.Context, arg *model.AutocompleteArg, mode model.AutocompleteMatchMode, parsed, toBeParsed, userID, teamID, channelID string) (found bool, alreadyParsed string, yetToBeParsed string, suggestions []model.AutocompleteSuggestion) {
+	if ctx.Err() != nil {
+		return false, parsed, toBeParsed, []model.AutocompleteSuggestion{}
+	}
+	entityArg := arg.Data.(*model.AutocompleteEntityArg)
+	in := strings.TrimPrefix(toBeParsed, " ")
+	term := in
+	if index := strings.Index(in, " "); index != -1 {
+		term = in[:index]
+	}
+	items, err := a.entitySuggestions(entityArg, userID, teamID, channelID, term)
+	if err != nil {
+		a.Log().Error("Can't fetch entity list arguments", mlog.String("entity", entityArg.Entity), mlog.Err(err))
+		return false, parsed, toBeParsed, []model.AutocompleteSuggestion{}
+	}
+	return parseListItems(items, mode, parsed, toBeParsed)
+}
+
+// entitySuggestions looks up autocomplete candidates for a built-in entity argument, scoped to
+// what userID is allowed to see in teamID/channelID.
+func (a *App) entitySuggestions(arg *model.AutocompleteEntityArg, userID, teamID, channelID, term string) ([]model.AutocompleteListItem, error) {
+	switch arg.Entity {
+	case "user":
+		return a.userEntitySuggestions(arg, userID, teamID, channelID, term)
+	case "channel":
+		return a.channelEntitySuggestions(arg, userID, teamID, term)
+	case "team":
+		return a.teamEntitySuggestions(arg, userID, term)
+	case "post":
+		return a.postEntitySuggestions(arg, userID, teamID, channelID, term)
+	default:
+		return nil, errors.Errorf("unsupported autocomplete entity %q", arg.Entity)
+	}
+}
+
+func (a *App) userEntitySuggestions(arg *model.AutocompleteEntityArg, userID, teamID, channelID, term string) ([]model.AutocompleteListItem, error) {
+	options := &model.UserSearchOptions{
+		AllowEmails:      false,
+		AllowFullNames:   true,
+		AllowInactive:    arg.IncludeDeleted,
+		Limit:            model.USER_SEARCH_DEFAULT_LIMIT,
+		ViewRestrictions: a.GetViewUsersRestrictions(userID),
+	}
+
+	var users []*model.User
+	var err *model.AppError
+	switch arg.Scope {
+	case "channel":
+		users, err = a.SearchUsersInChannel(channelID, term, options)
+	case "team":
+		users, err = a.SearchUsersInTeam(teamID, term, options)
+	default:
+		users, err = a.SearchUsers(&model.UserSearch{Term: term}, options)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]model.AutocompleteListItem, 0, len(users))
+	for _, user := range users {
+		items = append(items, model.AutocompleteListItem{
+			Item:     user.Username,
+			Hint:     user.GetDisplayName(model.SHOW_USERNAME),
+			HelpText: user.Email,
+		})
+	}
+	return items, nil
+}
+
+func (a *App) channelEntitySuggestions(arg *model.AutocompleteEntityArg, userID, teamID, term string) ([]model.AutocompleteListItem, error) {
+	var channels *model.ChannelList
+	var err *model.AppError
+	if arg.Scope == "team" || arg.Scope == "channel" {
+		channels, err = a.SearchChannels(teamID, term)
+	} else {
+		channels, err = a.SearchAllChannels(term, model.ChannelSearchOpts{IncludeDeleted: arg.IncludeDeleted, NotAssociatedToGroup: "", ExcludeDefaultChannels: false})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]model.AutocompleteListItem, 0, len(*channels))
+	for _, channel := range *channels {
+		if !arg.IncludeDeleted && channel.DeleteAt != 0 {
+			continue
+		}
+		if _, appErr := a.GetChannelMember(channel.Id, userID); appErr != nil {
+			continue
+		}
+		items = append(items, model.AutocompleteListItem{
+			Item:     channel.Name,
+			Hint:     channel.DisplayName,
+			HelpText: channel.Purpose,
+		})
+	}
+	return items, nil
+}
+
+func (a *App) teamEntitySuggestions(arg *model.AutocompleteEntityArg, userID, term string) ([]model.AutocompleteListItem, error) {
+	teams, err := a.SearchAllTeams(&model.TeamSearch{Term: term})
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]model.AutocompleteListItem, 0, len(teams))
+	for _, team := range teams {
+		if !arg.IncludeDeleted && team.DeleteAt != 0 {
+			continue
+		}
+		if _, appErr := a.GetTeamMember(team.Id, userID); appErr != nil {
+			continue
+		}
+		items = append(items, model.AutocompleteListItem{
+			Item:     team.Name,
+			Hint:     team.DisplayName,
+			HelpText: team.Description,
+		})
+	}
+	return items, nil
 }
 
-func parseListItems(items []model.AutocompleteListItem, parsed, toBeParsed string) (bool, string, string, []model.AutocompleteSuggestion) {
+// postEntitySearchPerPage is the page size passed to SearchPostsInTeamForUser. 0 is not "no
+// limit" there, it's "zero results", so an explicit default is required.
+const postEntitySearchPerPage = 20
+
+func (a *App) postEntitySuggestions(arg *model.AutocompleteEntityArg, userID, teamID, channelID, term string) ([]model.AutocompleteListItem, error) {
+	if term == "" { // avoid a search-index round trip for every keystroke before typing starts
+		return []model.AutocompleteListItem{}, nil
+	}
+	if _, appErr := a.GetChannelMember(channelID, userID); appErr != nil {
+		return nil, appErr
+	}
+	results, err := a.SearchPostsInTeamForUser(teamID, userID, model.SearchParameter{Terms: &term, IsOrSearch: false, IncludeDeletedChannels: &arg.IncludeDeleted}, false, postEntitySearchPerPage)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]model.AutocompleteListItem, 0, len(results.Order))
+	for _, postID := range results.Order {
+		post, ok := results.Posts[postID]
+		if !ok || post.ChannelId != channelID {
+			continue
+		}
+		items = append(items, model.AutocompleteListItem{
+			Item:     post.Id,
+			Hint:     post.Message,
+			HelpText: post.Type,
+		})
+	}
+	return items, nil
+}
+
+func parseListItems(items []model.AutocompleteListItem, mode model.AutocompleteMatchMode, parsed, toBeParsed string) (bool, string, string, []model.AutocompleteSuggestion) {
 	in := strings.TrimPrefix(toBeParsed, " ")
 	suggestions := []model.AutocompleteSuggestion{}
 	maxPrefix := ""
@@ -251,11 +836,208 @@ func parseListItems(items []model.AutocompleteListItem, parsed, toBeParsed strin
 	if maxPrefix != "" { //typing of an argument finished
 		return false, parsed + in[:len(maxPrefix)], in[len(maxPrefix):], []model.AutocompleteSuggestion{}
 	}
-	// user has not finished typing static argument
+	// user has not finished typing the argument
 	for _, arg := range items {
-		if strings.HasPrefix(strings.ToLower(arg.Item), strings.ToLower(in)) {
-			suggestions = append(suggestions, model.AutocompleteSuggestion{Complete: parsed + arg.Item, Suggestion: arg.Item, Hint: arg.Hint, Description: arg.HelpText})
+		matched, score, matchedIndexes := matchCandidate(mode, in, arg.Item)
+		if !matched {
+			continue
 		}
+		suggestions = append(suggestions, model.AutocompleteSuggestion{
+			Complete:       parsed + arg.Item,
+			Suggestion:     arg.Item,
+			Hint:           arg.Hint,
+			Description:    arg.HelpText,
+			Score:          score,
+			MatchedIndexes: matchedIndexes,
+		})
 	}
+	sortSuggestionsByScore(suggestions)
 	return true, parsed + toBeParsed, "", suggestions
 }
+
+// autocompleteSessionTTL is how long an AutocompleteSession survives without a query before
+// autocompleteSessionStore considers it expired and evicts it.
+const autocompleteSessionTTL = 2 * time.Minute
+
+// autocompleteSessionQueryRate and autocompleteSessionQueryBurst bound how often a single
+// session may be queried, so a client stuck resending queries (or a runaway retry loop) can't
+// drive unbounded server-side work.
+const (
+	autocompleteSessionQueryRate  = 20 // queries per second
+	autocompleteSessionQueryBurst = 10
+)
+
+// AutocompleteSession is the App-layer state backing one WEBSOCKET_EVENT_AUTOCOMPLETE_QUERY /
+// WEBSOCKET_EVENT_AUTOCOMPLETE_RESULT conversation: a WebSocket handler (outside this package)
+// reads autocomplete_query events off the socket, calls AutocompleteQuery for each, and writes
+// its result back as autocomplete_result. AutocompleteSession itself remembers the commands
+// being completed and the input parsed so far, so that subsequent queries only need to send what
+// changed.
+type AutocompleteSession struct {
+	id        string
+	userID    string
+	roleID    string
+	teamID    string
+	channelID string
+	commands  []*model.Command
+
+	mu         sync.Mutex
+	fullInput  string
+	lastSeenAt int64
+	// generation is bumped by every AutocompleteQuery call. A handler running queries for the
+	// same session concurrently should compare Generation() before writing an autocomplete_result
+	// back to the client, so a result superseded by a later keystroke (e.g. one still waiting on
+	// a slow plugin GET) is dropped instead of racing the newer one.
+	generation int64
+	tokens     float64
+	// cancel cancels the context passed to the in-flight AutocompleteQuery call, if any. Each new
+	// call cancels its predecessor's context before starting, so work already superseded by a
+	// newer keystroke stops issuing further plugin GETs or entity lookups (see GetSuggestions);
+	// it cannot abort a plugin GET already dispatched.
+	cancel context.CancelFunc
+}
+
+var (
+	autocompleteSessionStore   = map[string]*AutocompleteSession{}
+	autocompleteSessionStoreMu sync.Mutex
+)
+
+// StartAutocompleteSession opens a new AutocompleteSession for a WebSocket client about to send
+// autocomplete_query events, and returns its ID.
+func (a *App) StartAutocompleteSession(commands []*model.Command, roleID, userID, teamID, channelID string) string {
+	session := &AutocompleteSession{
+		id:         model.NewId(),
+		userID:     userID,
+		roleID:     roleID,
+		teamID:     teamID,
+		channelID:  channelID,
+		commands:   commands,
+		lastSeenAt: model.GetMillis(),
+		tokens:     autocompleteSessionQueryBurst,
+	}
+
+	autocompleteSessionStoreMu.Lock()
+	defer autocompleteSessionStoreMu.Unlock()
+	pruneExpiredAutocompleteSessionsLocked()
+	autocompleteSessionStore[session.id] = session
+	return session.id
+}
+
+// EndAutocompleteSession releases an AutocompleteSession, e.g. when the client disconnects or
+// submits the command, canceling its in-flight AutocompleteQuery, if any.
+func (a *App) EndAutocompleteSession(sessionID string) {
+	autocompleteSessionStoreMu.Lock()
+	defer autocompleteSessionStoreMu.Unlock()
+	if session, ok := autocompleteSessionStore[sessionID]; ok {
+		session.mu.Lock()
+		if session.cancel != nil {
+			session.cancel()
+		}
+		session.mu.Unlock()
+	}
+	delete(autocompleteSessionStore, sessionID)
+}
+
+// AutocompleteQuery applies delta to sessionID's remembered input and returns fresh suggestions,
+// as if the client had sent its whole input again, along with the generation this query was
+// assigned. It cancels the context of any AutocompleteQuery call still in flight on this session,
+// so a slow plugin GET for input the client has since moved past stops issuing further fetches.
+// A caller driving several queries on the same session concurrently (as the WebSocket handler
+// does, so one slow plugin GET doesn't hold up the next keystroke) should compare the returned
+// generation against AutocompleteSession.Generation() before acting on the result, and drop it if
+// a later query has already started.
+func (a *App) AutocompleteQuery(sessionID string, delta model.AutocompleteDelta) (suggestions []model.AutocompleteSuggestion, generation int64, err error) {
+	session, ok := getAutocompleteSession(sessionID)
+	if !ok {
+		return nil, 0, errors.Errorf("autocomplete session %q not found or expired", sessionID)
+	}
+
+	session.mu.Lock()
+	if !session.takeQueryToken() {
+		session.mu.Unlock()
+		return nil, 0, errors.Errorf("autocomplete session %q exceeded its query rate limit", sessionID)
+	}
+	session.generation++
+	generation = session.generation
+	session.lastSeenAt = model.GetMillis()
+
+	if session.cancel != nil {
+		session.cancel()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	session.cancel = cancel
+
+	if delta.Removed > 0 {
+		// delta.Removed is a rune count; session.fullInput is indexed by byte, so multibyte input
+		// must be decoded before trimming or this can slice mid-rune.
+		runes := []rune(session.fullInput)
+		if delta.Removed >= len(runes) {
+			session.fullInput = ""
+		} else {
+			session.fullInput = string(runes[:len(runes)-delta.Removed])
+		}
+	}
+	session.fullInput += delta.Appended
+	fullInput := session.fullInput
+	session.mu.Unlock()
+
+	return a.GetSuggestions(ctx, session.commands, fullInput, session.roleID, session.userID, session.teamID, session.channelID), generation, nil
+}
+
+// Generation returns the sequence number of the most recent AutocompleteQuery call on this
+// session, for the caller-side staleness check described on AutocompleteQuery.
+func (s *AutocompleteSession) Generation() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.generation
+}
+
+// GetAutocompleteSession looks up a previously started AutocompleteSession, e.g. so the
+// WebSocket handler can read its Generation() for the staleness check described on
+// AutocompleteQuery.
+func (a *App) GetAutocompleteSession(sessionID string) (*AutocompleteSession, bool) {
+	return getAutocompleteSession(sessionID)
+}
+
+func getAutocompleteSession(sessionID string) (*AutocompleteSession, bool) {
+	autocompleteSessionStoreMu.Lock()
+	defer autocompleteSessionStoreMu.Unlock()
+	pruneExpiredAutocompleteSessionsLocked()
+	session, ok := autocompleteSessionStore[sessionID]
+	return session, ok
+}
+
+// pruneExpiredAutocompleteSessionsLocked evicts sessions idle for longer than
+// autocompleteSessionTTL. Callers must hold autocompleteSessionStoreMu.
+func pruneExpiredAutocompleteSessionsLocked() {
+	cutoff := model.GetMillis() - autocompleteSessionTTL.Milliseconds()
+	for id, session := range autocompleteSessionStore {
+		session.mu.Lock()
+		expired := session.lastSeenAt < cutoff
+		if expired && session.cancel != nil {
+			session.cancel()
+		}
+		session.mu.Unlock()
+		if expired {
+			delete(autocompleteSessionStore, id)
+		}
+	}
+}
+
+// takeQueryToken applies a token-bucket rate limit, refilling at autocompleteSessionQueryRate
+// tokens/second up to autocompleteSessionQueryBurst. Callers must hold session.mu.
+func (s *AutocompleteSession) takeQueryToken() bool {
+	now := model.GetMillis()
+	elapsedSeconds := float64(now-s.lastSeenAt) / 1000
+	if elapsedSeconds > 0 {
+		s.tokens = math.Min(autocompleteSessionQueryBurst, s.tokens+elapsedSeconds*autocompleteSessionQueryRate)
+	}
+	// Rejected queries must advance the refill clock too, or the same elapsed time is credited
+	// again on every rejection.
+	s.lastSeenAt = now
+	if s.tokens < 1 {
+		return false
+	}
+	s.tokens--
+	return true
+}
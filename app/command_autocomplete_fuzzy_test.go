@@ -0,0 +1,104 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package app
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+func TestFuzzyMatch(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		candidate string
+		matched   bool
+	}{
+		{"empty input matches anything", "", "jira", true},
+		{"exact match", "jira", "jira", true},
+		{"in-order subsequence matches", "jra", "jira", true},
+		{"out-of-order is not a subsequence", "ajir", "jira", false},
+		{"missing rune does not match", "jirax", "jira", false},
+		{"case insensitive", "JIR", "jira", true},
+		{"subsequence across a long gap can score below the cutoff", "az", "abcdefghijklmnopqrstuvwxyz", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matched, _, _ := fuzzyMatch(tt.input, tt.candidate)
+			assert.Equal(t, tt.matched, matched)
+		})
+	}
+}
+
+func TestFuzzyMatchScoring(t *testing.T) {
+	t.Run("consecutive runs score higher than scattered ones", func(t *testing.T) {
+		_, consecutiveScore, _ := fuzzyMatch("jir", "jira")
+		_, scatteredScore, _ := fuzzyMatch("ja", "jira")
+		assert.Greater(t, consecutiveScore, scatteredScore)
+	})
+
+	t.Run("a word-boundary hit scores higher than a mid-word hit", func(t *testing.T) {
+		_, boundaryScore, _ := fuzzyMatch("z", "jira-zendesk")
+		_, midWordScore, _ := fuzzyMatch("e", "jira-zendesk")
+		assert.Greater(t, boundaryScore, midWordScore)
+	})
+
+	t.Run("a camelCase hump counts as a word boundary", func(t *testing.T) {
+		matched, score, matchedIndexes := fuzzyMatch("sq", "assignQueue")
+		require.True(t, matched)
+		assert.Equal(t, []int{1, 6}, matchedIndexes)
+		_, noBoundaryScore, _ := fuzzyMatch("sq", "bassqueue")
+		assert.Greater(t, score, noBoundaryScore)
+	})
+
+	t.Run("scores below fuzzyMinScore are rejected", func(t *testing.T) {
+		matched, _, _ := fuzzyMatch("az", "abcdefghijklmnopqrstuvwxyz")
+		assert.False(t, matched)
+	})
+
+	t.Run("matchedIndexes are candidate rune offsets in match order", func(t *testing.T) {
+		matched, _, matchedIndexes := fuzzyMatch("ir", "jira")
+		require.True(t, matched)
+		assert.Equal(t, []int{1, 2}, matchedIndexes)
+	})
+}
+
+func TestIsFuzzyWordBoundary(t *testing.T) {
+	candidate := []rune("jira-zendeskPlugin")
+	tests := []struct {
+		index    int
+		boundary bool
+	}{
+		{0, true},   // first rune
+		{5, true},   // right after '-'
+		{12, true},  // 'P' of the camelCase hump
+		{1, false},  // mid-word
+		{13, false}, // mid-word after the hump
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.boundary, isFuzzyWordBoundary(candidate, tt.index), "index %d", tt.index)
+	}
+}
+
+func TestMatchCandidateFuzzyMode(t *testing.T) {
+	matched, _, _ := matchCandidate(model.AutocompleteMatchModeFuzzy, "jr", "jira")
+	assert.True(t, matched)
+
+	matched, _, _ = matchCandidate(model.AutocompleteMatchModeFuzzy, "xyz", "jira")
+	assert.False(t, matched)
+}
+
+func TestMatchCandidatePrefixMode(t *testing.T) {
+	matched, score, matchedIndexes := matchCandidate("", "ji", "jira")
+	assert.True(t, matched)
+	assert.Zero(t, score)
+	assert.Nil(t, matchedIndexes)
+
+	matched, _, _ = matchCandidate("", "ir", "jira")
+	assert.False(t, matched)
+}
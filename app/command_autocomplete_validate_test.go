@@ -0,0 +1,113 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package app
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+func TestParseInputNumberArgument(t *testing.T) {
+	min := 1.0
+	max := 10.0
+	arg := &model.AutocompleteArg{
+		HelpText: "a number",
+		Data:     &model.AutocompleteNumberArg{Min: &min, Max: &max},
+	}
+
+	tests := []struct {
+		name          string
+		toBeParsed    string
+		found         bool
+		wantErrorHint string
+	}{
+		{"nothing typed yet", "", true, ""},
+		{"bare minus sign could still become a valid number", "-", true, ""},
+		{"trailing decimal point could still become a valid number", "3.", true, ""},
+		{"a finished non-number is rejected", "abc ", true, "expected a number"},
+		{"a finished out-of-range number is rejected", "100 ", true, "must be between 1 and 10"},
+		{"a finished in-range number is accepted", "5 ", false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found, _, _, suggestion := parseInputNumberArgument(arg, "", tt.toBeParsed)
+			assert.Equal(t, tt.found, found)
+			assert.Equal(t, tt.wantErrorHint, suggestion.ErrorHint)
+		})
+	}
+}
+
+func TestParseInputBoolArgument(t *testing.T) {
+	arg := &model.AutocompleteArg{HelpText: "a bool"}
+
+	tests := []struct {
+		name          string
+		toBeParsed    string
+		found         bool
+		wantErrorHint string
+	}{
+		{"nothing typed yet", "", true, ""},
+		{"still typing, not a rejection yet", "tr", true, ""},
+		{"a finished invalid value is rejected", "yes ", true, "expected true or false"},
+		{"true is accepted case-insensitively", "TRUE ", false, ""},
+		{"false is accepted", "false ", false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found, _, _, suggestion := parseInputBoolArgument(arg, "", tt.toBeParsed)
+			assert.Equal(t, tt.found, found)
+			assert.Equal(t, tt.wantErrorHint, suggestion.ErrorHint)
+		})
+	}
+}
+
+func TestParseInputDateArgument(t *testing.T) {
+	arg := &model.AutocompleteArg{HelpText: "a date", Data: &model.AutocompleteDateArg{}}
+
+	tests := []struct {
+		name          string
+		toBeParsed    string
+		found         bool
+		wantErrorHint string
+	}{
+		{"nothing typed yet", "", true, ""},
+		{"still typing, not a rejection yet", "2020-0", true, ""},
+		{"a finished value not matching the layout is rejected", "06/15/2020 ", true, "expected format YYYY-MM-DD"},
+		{"a finished value matching the default layout is accepted", "2020-06-15 ", false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found, _, _, suggestion := parseInputDateArgument(arg, "", tt.toBeParsed)
+			assert.Equal(t, tt.found, found)
+			assert.Equal(t, tt.wantErrorHint, suggestion.ErrorHint)
+		})
+	}
+}
+
+func TestParseInputRegexArgument(t *testing.T) {
+	arg := &model.AutocompleteArg{HelpText: "a ticket id", Data: &model.AutocompleteRegexArg{Pattern: "[A-Z]+-[0-9]+"}}
+
+	tests := []struct {
+		name          string
+		toBeParsed    string
+		found         bool
+		wantErrorHint string
+	}{
+		{"nothing typed yet", "", true, ""},
+		{"still typing, not a rejection yet", "ABC", true, ""},
+		{"a finished non-matching value is rejected", "abc-123 ", true, "must match pattern [A-Z]+-[0-9]+"},
+		{"a pattern is anchored, so a superstring does not match", "XABC-123Y ", true, "must match pattern [A-Z]+-[0-9]+"},
+		{"a finished matching value is accepted", "ABC-123 ", false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found, _, _, suggestion := parseInputRegexArgument(arg, "", tt.toBeParsed)
+			assert.Equal(t, tt.found, found)
+			assert.Equal(t, tt.wantErrorHint, suggestion.ErrorHint)
+		})
+	}
+}
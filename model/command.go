@@ -0,0 +1,35 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package model
+
+// Command is a registered slash command, either built-in or provided by an
+// integration, along with the metadata used to autocomplete it.
+type Command struct {
+	Id               string            `json:"id"`
+	Token            string            `json:"token"`
+	CreateAt         int64             `json:"create_at"`
+	UpdateAt         int64             `json:"update_at"`
+	DeleteAt         int64             `json:"delete_at"`
+	CreatorId        string            `json:"creator_id"`
+	TeamId           string            `json:"team_id"`
+	Trigger          string            `json:"trigger"`
+	Method           string            `json:"method"`
+	Username         string            `json:"username"`
+	IconURL          string            `json:"icon_url"`
+	AutoComplete     bool              `json:"auto_complete"`
+	AutoCompleteDesc string            `json:"auto_complete_desc"`
+	AutoCompleteHint string            `json:"auto_complete_hint"`
+	DisplayName      string            `json:"display_name"`
+	Description      string            `json:"description"`
+	URL              string            `json:"url"`
+	PluginId         string            `json:"plugin_id"`
+
+	// AutocompleteData holds the structured description of the command's
+	// arguments. It is generated lazily from the legacy AutoComplete* fields
+	// when a plugin only registers the simple form.
+	AutocompleteData *AutocompleteData `json:"autocomplete_data,omitempty"`
+	// AutocompleteIconData is a base64 encoded svg used next to suggestions
+	// for this command.
+	AutocompleteIconData string `json:"autocomplete_icon_data,omitempty"`
+}
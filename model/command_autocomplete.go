@@ -0,0 +1,266 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	SYSTEM_ADMIN_ROLE_ID = "system_admin"
+)
+
+// AutocompleteArgType describes the kind of value an AutocompleteArg expects.
+type AutocompleteArgType string
+
+const (
+	AutocompleteArgTypeText        AutocompleteArgType = "TextInput"
+	AutocompleteArgTypeStaticList  AutocompleteArgType = "StaticList"
+	AutocompleteArgTypeDynamicList AutocompleteArgType = "DynamicList"
+	AutocompleteArgTypeEntity      AutocompleteArgType = "EntityList"
+	AutocompleteArgTypeNumber      AutocompleteArgType = "Number"
+	AutocompleteArgTypeBool        AutocompleteArgType = "Bool"
+	AutocompleteArgTypeDate        AutocompleteArgType = "Date"
+	AutocompleteArgTypeRegex       AutocompleteArgType = "Regex"
+)
+
+// AutocompleteMatchMode controls how candidate triggers and items are matched
+// against the text the user has typed so far.
+type AutocompleteMatchMode string
+
+const (
+	// AutocompleteMatchModePrefix is the default, backward-compatible mode:
+	// a candidate matches only if the input is a literal prefix of it.
+	AutocompleteMatchModePrefix AutocompleteMatchMode = "prefix"
+	// AutocompleteMatchModeFuzzy allows the input characters to match as a
+	// subsequence of the candidate, ranked by how well they line up.
+	AutocompleteMatchModeFuzzy AutocompleteMatchMode = "fuzzy"
+)
+
+// AutocompleteData describes a command or subcommand and how to autocomplete
+// its arguments.
+type AutocompleteData struct {
+	Trigger     string
+	HelpText    string
+	Hint        string
+	RoleID      string
+	Arguments   []*AutocompleteArg
+	SubCommands []*AutocompleteData
+	// MatchMode controls how this command's trigger (and, recursively, its
+	// static/dynamic list arguments) are matched against user input. Empty
+	// behaves as AutocompleteMatchModePrefix.
+	MatchMode AutocompleteMatchMode
+}
+
+// NewAutocompleteData creates an AutocompleteData for a command with the
+// given trigger, argument hint and help text.
+func NewAutocompleteData(trigger, hint, helpText string) *AutocompleteData {
+	return &AutocompleteData{
+		Trigger:     trigger,
+		Hint:        hint,
+		HelpText:    helpText,
+		Arguments:   []*AutocompleteArg{},
+		SubCommands: []*AutocompleteData{},
+	}
+}
+
+// AutocompleteArg describes one positional or named argument of a command.
+type AutocompleteArg struct {
+	Name     string // Named argument if non-empty, positional otherwise
+	Hint     string
+	HelpText string
+	Type     AutocompleteArgType
+	Required bool
+	Data     interface{}
+}
+
+// AutocompleteTextArg is the Data for an AutocompleteArgTypeText argument.
+type AutocompleteTextArg struct {
+	Hint    string
+	Pattern string
+}
+
+// AutocompleteNumberArg is the Data for an AutocompleteArgTypeNumber argument. Min and Max are
+// optional; a nil bound is not enforced.
+type AutocompleteNumberArg struct {
+	Min *float64
+	Max *float64
+}
+
+// Validate returns an empty string if value satisfies Min/Max, or a human-readable hint
+// describing why it doesn't (for AutocompleteSuggestion.ErrorHint).
+func (a *AutocompleteNumberArg) Validate(value float64) string {
+	switch {
+	case a.Min != nil && a.Max != nil:
+		if value < *a.Min || value > *a.Max {
+			return fmt.Sprintf("must be between %v and %v", *a.Min, *a.Max)
+		}
+	case a.Min != nil:
+		if value < *a.Min {
+			return fmt.Sprintf("must be at least %v", *a.Min)
+		}
+	case a.Max != nil:
+		if value > *a.Max {
+			return fmt.Sprintf("must be at most %v", *a.Max)
+		}
+	}
+	return ""
+}
+
+// AutocompleteBoolArg is the Data for an AutocompleteArgTypeBool argument. It takes no fields
+// today; it exists so bool arguments have their own Data type like every other typed argument.
+type AutocompleteBoolArg struct{}
+
+// AutocompleteDateArgDefaultFormat is used when AutocompleteDateArg.Format is empty.
+const AutocompleteDateArgDefaultFormat = "YYYY-MM-DD"
+
+// AutocompleteDateArg is the Data for an AutocompleteArgTypeDate argument. Format is a
+// human-readable date format (e.g. "YYYY-MM-DD"); see GoLayout for how it maps to a Go time
+// layout.
+type AutocompleteDateArg struct {
+	Format string
+}
+
+// DisplayFormat returns a.Format, or AutocompleteDateArgDefaultFormat if it's empty.
+func (a *AutocompleteDateArg) DisplayFormat() string {
+	if a.Format == "" {
+		return AutocompleteDateArgDefaultFormat
+	}
+	return a.Format
+}
+
+// GoLayout translates DisplayFormat into the equivalent Go time.Parse reference layout. Only
+// the YYYY-MM-DD family used by Mattermost's commands is supported.
+func (a *AutocompleteDateArg) GoLayout() string {
+	replacer := strings.NewReplacer("YYYY", "2006", "MM", "01", "DD", "02")
+	return replacer.Replace(a.DisplayFormat())
+}
+
+// AutocompleteRegexArg is the Data for an AutocompleteArgTypeRegex argument.
+type AutocompleteRegexArg struct {
+	Pattern string
+}
+
+// AutocompleteListItem is a single suggestion for a static or dynamic list
+// argument.
+type AutocompleteListItem struct {
+	Item     string
+	Hint     string
+	HelpText string
+}
+
+// AutocompleteStaticListArg is the Data for an AutocompleteArgTypeStaticList
+// argument.
+type AutocompleteStaticListArg struct {
+	PossibleArguments []AutocompleteListItem
+}
+
+// AutocompleteCachePolicy controls whether, and how, App.GetDynamicListArgument may reuse a
+// previous response instead of issuing a new plugin HTTP GET.
+type AutocompleteCachePolicy string
+
+const (
+	// AutocompleteCachePolicyNone disables caching: every keystroke fetches again.
+	AutocompleteCachePolicyNone AutocompleteCachePolicy = "none"
+	// AutocompleteCachePolicyPrefix allows a response fetched for a shorter prefix of the
+	// current input to be reused and filtered in memory, in addition to exact-input reuse.
+	AutocompleteCachePolicyPrefix AutocompleteCachePolicy = "prefix"
+	// AutocompleteCachePolicyExact only reuses a response fetched for the exact same input.
+	AutocompleteCachePolicyExact AutocompleteCachePolicy = "exact"
+)
+
+// AutocompleteDynamicListArg is the Data for an AutocompleteArgTypeDynamicList
+// argument.
+type AutocompleteDynamicListArg struct {
+	FetchURL string
+	// CachePolicy opts this argument's fetches into caching with TTL/ETag revalidation. Empty
+	// behaves as AutocompleteCachePolicyNone.
+	CachePolicy AutocompleteCachePolicy
+}
+
+// AutocompleteEntityArg is the Data for an AutocompleteArgTypeEntity argument: it asks the
+// server to suggest Mattermost entities (users, channels, teams, posts) directly, instead of
+// a command fetching and declaring the list itself.
+type AutocompleteEntityArg struct {
+	Entity         string // "user", "channel", "team" or "post"
+	Scope          string // "team", "channel" or "global"
+	IncludeDeleted bool
+}
+
+// AddNamedArgumentEntity adds a named argument suggesting one of the built-in entity types
+// (see AutocompleteEntityArg) without the command having to fetch and declare the list itself.
+func (ad *AutocompleteData) AddNamedArgumentEntity(name, hint, helpText, entity, scope string, required, includeDeleted bool) {
+	ad.Arguments = append(ad.Arguments, &AutocompleteArg{
+		Name:     name,
+		Hint:     hint,
+		HelpText: helpText,
+		Type:     AutocompleteArgTypeEntity,
+		Required: required,
+		Data: &AutocompleteEntityArg{
+			Entity:         entity,
+			Scope:          scope,
+			IncludeDeleted: includeDeleted,
+		},
+	})
+}
+
+// AutocompleteSuggestion is one completion offered to the user for their
+// current input.
+type AutocompleteSuggestion struct {
+	Complete    string
+	Suggestion  string
+	Hint        string
+	Description string
+	IconData    string
+	// Score ranks this suggestion against its siblings when MatchMode is
+	// AutocompleteMatchModeFuzzy; higher is a better match. It is left at
+	// zero, and suggestions keep input order, under prefix matching.
+	Score int
+	// MatchedIndexes holds the rune offsets into Suggestion that matched the
+	// user's input, so clients can render them highlighted. Unused under
+	// prefix matching, where the match is always the leading run of runes.
+	MatchedIndexes []int
+	// ErrorHint is set instead of Hint when the user has finished typing a typed argument
+	// (AutocompleteArgTypeNumber/Bool/Date/Regex) with a value that fails validation, e.g.
+	// "must be between 1 and 100". Clients should render it as inline feedback rather than
+	// treating this suggestion as something to complete to.
+	ErrorHint string
+}
+
+func AutocompleteStaticListItemsFromJSON(data io.Reader) []AutocompleteListItem {
+	var items []AutocompleteListItem
+	json.NewDecoder(data).Decode(&items)
+	return items
+}
+
+const (
+	WEBSOCKET_EVENT_AUTOCOMPLETE_QUERY  = "autocomplete_query"
+	WEBSOCKET_EVENT_AUTOCOMPLETE_RESULT = "autocomplete_result"
+)
+
+// AutocompleteDelta describes how a client's input changed since its last autocomplete_query:
+// runes removed from the end (e.g. backspace), then runes appended to what remains. Sending a
+// delta means the client does not resend its whole input; App.AutocompleteQuery applies it to the
+// session's remembered input and then parses that full input again from the start. No parse
+// state is carried over between queries.
+type AutocompleteDelta struct {
+	Removed  int    `json:"removed"`
+	Appended string `json:"appended"`
+}
+
+// AutocompleteQueryMsg is the payload of a WEBSOCKET_EVENT_AUTOCOMPLETE_QUERY event.
+type AutocompleteQueryMsg struct {
+	SessionId string            `json:"session_id"`
+	Delta     AutocompleteDelta `json:"delta"`
+}
+
+// AutocompleteResultMsg is the payload of a WEBSOCKET_EVENT_AUTOCOMPLETE_RESULT event.
+type AutocompleteResultMsg struct {
+	SessionId   string                   `json:"session_id"`
+	Suggestions []AutocompleteSuggestion `json:"suggestions"`
+	Error       string                   `json:"error,omitempty"`
+}